@@ -0,0 +1,97 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package address
+
+import (
+	"fmt"
+	"net/http"
+
+	compute "google.golang.org/api/compute/v1"
+
+	"k8s.io/ingress-gce/pkg/utils"
+
+	"github.com/GoogleCloudPlatform/k8s-multicluster-ingress/app/kubemci/pkg/gcp/logging"
+	utilsnamer "github.com/GoogleCloudPlatform/k8s-multicluster-ingress/app/kubemci/pkg/gcp/namer"
+)
+
+// AddressSyncer manages the global static IP for a multicluster GCP L7 load balancer.
+type AddressSyncer struct {
+	namer  *utilsnamer.Namer
+	ap     AddressProvider
+	logger logging.Logger
+}
+
+// NewAddressSyncer returns a new syncer for managing the global static IP of the given load balancer.
+// A nil logger defaults to logging.NopLogger, so existing callers keep working unchanged.
+func NewAddressSyncer(namer *utilsnamer.Namer, ap AddressProvider, logger logging.Logger) AddressSyncerInterface {
+	if logger == nil {
+		logger = logging.NopLogger{}
+	}
+	return &AddressSyncer{
+		namer:  namer,
+		ap:     ap,
+		logger: logger,
+	}
+}
+
+// Ensure this implements AddressSyncerInterface.
+var _ AddressSyncerInterface = &AddressSyncer{}
+
+// EnsureAddress ensures that a global IP exists for the load balancer and returns it.
+func (s *AddressSyncer) EnsureAddress(ipName string) (string, error) {
+	if ipName != "" {
+		s.logger.V(2).Info("using user specified static IP", "ipName", ipName)
+		addr, err := s.ap.GetGlobalAddress(ipName)
+		if err != nil {
+			return "", fmt.Errorf("error in fetching user specified static IP %s: %s", ipName, err)
+		}
+		return addr.Address, nil
+	}
+	name := s.namer.IPAddressName()
+	addr, err := s.ap.GetGlobalAddress(name)
+	if err == nil {
+		s.logger.V(2).Info("controller-managed static IP already exists", "name", name)
+		return addr.Address, nil
+	}
+	if !utils.IsHTTPErrorCode(err, http.StatusNotFound) {
+		return "", fmt.Errorf("error in fetching static IP %s: %s", name, err)
+	}
+	s.logger.Info("reserving a new static IP", "name", name)
+	desc := fmt.Sprintf("Global IP address reserved by kubemci for load balancer %s. Do not delete this manually.", s.namer.LbName())
+	if err := s.ap.ReserveGlobalAddress(&compute.Address{
+		Name:        name,
+		Description: desc,
+	}); err != nil {
+		return "", fmt.Errorf("error in reserving static IP %s: %s", name, err)
+	}
+	addr, err = s.ap.GetGlobalAddress(name)
+	if err != nil {
+		return "", fmt.Errorf("error in fetching newly reserved static IP %s: %s", name, err)
+	}
+	s.logger.Info("static IP reserved successfully", "name", name, "address", addr.Address)
+	return addr.Address, nil
+}
+
+// DeleteAddress deletes the controller-managed address, if any.
+func (s *AddressSyncer) DeleteAddress() error {
+	name := s.namer.IPAddressName()
+	s.logger.Info("deleting static IP", "name", name)
+	if err := utils.IgnoreHTTPNotFound(s.ap.DeleteGlobalAddress(name)); err != nil {
+		s.logger.Error(err, "error deleting static IP", "name", name)
+		return err
+	}
+	s.logger.V(2).Info("static IP deleted successfully (if it existed)", "name", name)
+	return nil
+}
@@ -0,0 +1,121 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package address
+
+import (
+	"net/http"
+	"testing"
+
+	"google.golang.org/api/googleapi"
+
+	compute "google.golang.org/api/compute/v1"
+
+	utilsnamer "github.com/GoogleCloudPlatform/k8s-multicluster-ingress/app/kubemci/pkg/gcp/namer"
+)
+
+// fakeAddressProvider fakes out the AddressProvider interface, storing addresses in memory.
+type fakeAddressProvider struct {
+	addresses    map[string]*compute.Address
+	reserveCalls []string
+	deleteCalls  []string
+}
+
+func newFakeAddressProvider() *fakeAddressProvider {
+	return &fakeAddressProvider{addresses: map[string]*compute.Address{}}
+}
+
+func (f *fakeAddressProvider) GetGlobalAddress(name string) (*compute.Address, error) {
+	if addr, ok := f.addresses[name]; ok {
+		return addr, nil
+	}
+	return nil, &googleapi.Error{Code: http.StatusNotFound, Message: "address not found"}
+}
+
+func (f *fakeAddressProvider) ReserveGlobalAddress(addr *compute.Address) error {
+	f.reserveCalls = append(f.reserveCalls, addr.Name)
+	reserved := *addr
+	reserved.Address = "1.2.3.4"
+	f.addresses[addr.Name] = &reserved
+	return nil
+}
+
+func (f *fakeAddressProvider) DeleteGlobalAddress(name string) error {
+	f.deleteCalls = append(f.deleteCalls, name)
+	if _, ok := f.addresses[name]; !ok {
+		return &googleapi.Error{Code: http.StatusNotFound, Message: "address not found"}
+	}
+	delete(f.addresses, name)
+	return nil
+}
+
+func TestEnsureAddressUserSuppliedName(t *testing.T) {
+	ap := newFakeAddressProvider()
+	ap.addresses["user-ip"] = &compute.Address{Name: "user-ip", Address: "5.6.7.8"}
+	namer := utilsnamer.NewNamer("lb1")
+	s := NewAddressSyncer(namer, ap, nil)
+
+	ip, err := s.EnsureAddress("user-ip")
+	if err != nil {
+		t.Fatalf("EnsureAddress() returned error: %v", err)
+	}
+	if ip != "5.6.7.8" {
+		t.Errorf("EnsureAddress() = %s, want 5.6.7.8", ip)
+	}
+	if len(ap.reserveCalls) != 0 {
+		t.Errorf("ReserveGlobalAddress called %d times, want 0 for a user-supplied IP", len(ap.reserveCalls))
+	}
+}
+
+func TestEnsureAddressReservesControllerManaged(t *testing.T) {
+	ap := newFakeAddressProvider()
+	namer := utilsnamer.NewNamer("lb1")
+	s := NewAddressSyncer(namer, ap, nil)
+
+	ip, err := s.EnsureAddress("")
+	if err != nil {
+		t.Fatalf("EnsureAddress() returned error: %v", err)
+	}
+	if ip != "1.2.3.4" {
+		t.Errorf("EnsureAddress() = %s, want 1.2.3.4", ip)
+	}
+	if len(ap.reserveCalls) != 1 {
+		t.Errorf("ReserveGlobalAddress called %d times, want 1", len(ap.reserveCalls))
+	}
+
+	// Calling again should reuse the already-reserved address rather than reserving a new one.
+	ip, err = s.EnsureAddress("")
+	if err != nil {
+		t.Fatalf("EnsureAddress() returned error: %v", err)
+	}
+	if ip != "1.2.3.4" {
+		t.Errorf("EnsureAddress() = %s, want 1.2.3.4", ip)
+	}
+	if len(ap.reserveCalls) != 1 {
+		t.Errorf("ReserveGlobalAddress called %d times, want 1 (reused on second call)", len(ap.reserveCalls))
+	}
+}
+
+func TestDeleteAddressNoopOnNotFound(t *testing.T) {
+	ap := newFakeAddressProvider()
+	namer := utilsnamer.NewNamer("lb1")
+	s := NewAddressSyncer(namer, ap, nil)
+
+	if err := s.DeleteAddress(); err != nil {
+		t.Fatalf("DeleteAddress() returned error: %v, want nil for a not-found address", err)
+	}
+	if len(ap.deleteCalls) != 1 {
+		t.Errorf("DeleteGlobalAddress called %d times, want 1", len(ap.deleteCalls))
+	}
+}
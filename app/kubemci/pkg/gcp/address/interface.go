@@ -0,0 +1,41 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package address
+
+import (
+	compute "google.golang.org/api/compute/v1"
+)
+
+// AddressSyncerInterface manages the global static IP that a multicluster GCP L7 load balancer uses.
+type AddressSyncerInterface interface {
+	// EnsureAddress ensures that a global IP exists for the load balancer and returns it.
+	// If ipName is non empty, it is assumed to be the name of a user-reserved global address
+	// (set via the kubernetes.io/ingress.global-static-ip-name annotation) and is resolved as is.
+	// If ipName is empty, a new controller-managed global address is reserved (and reused on
+	// subsequent calls), so that the ingress VIP remains stable across updates.
+	EnsureAddress(ipName string) (string, error)
+
+	// DeleteAddress deletes the controller-managed address that EnsureAddress reserved, if any.
+	// It is a no-op if the load balancer is using a user-specified address, since kubemci does not
+	// own the lifecycle of those.
+	DeleteAddress() error
+}
+
+// AddressProvider is the interface to the subset of the GCE Addresses API that AddressSyncer needs.
+type AddressProvider interface {
+	GetGlobalAddress(name string) (*compute.Address, error)
+	ReserveGlobalAddress(addr *compute.Address) error
+	DeleteGlobalAddress(name string) error
+}
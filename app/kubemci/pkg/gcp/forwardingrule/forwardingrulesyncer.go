@@ -17,18 +17,18 @@ package forwardingrule
 import (
 	"fmt"
 	"net/http"
-	"reflect"
 	"sort"
+	"strings"
 
 	compute "google.golang.org/api/compute/v1"
-	"google.golang.org/api/googleapi"
 
-	"github.com/golang/glog"
-	"k8s.io/apimachinery/pkg/util/diff"
 	ingresslb "k8s.io/ingress-gce/pkg/loadbalancers"
 	"k8s.io/ingress-gce/pkg/utils"
 
+	"github.com/GoogleCloudPlatform/k8s-multicluster-ingress/app/kubemci/pkg/gcp/address"
+	"github.com/GoogleCloudPlatform/k8s-multicluster-ingress/app/kubemci/pkg/gcp/logging"
 	utilsnamer "github.com/GoogleCloudPlatform/k8s-multicluster-ingress/app/kubemci/pkg/gcp/namer"
+	"github.com/GoogleCloudPlatform/k8s-multicluster-ingress/app/kubemci/pkg/gcp/reconciler"
 	"github.com/GoogleCloudPlatform/k8s-multicluster-ingress/app/kubemci/pkg/gcp/status"
 )
 
@@ -37,18 +37,53 @@ const (
 	httpsDefaultPortRange = "443-443"
 )
 
+// ForwardingRuleSpec describes the desired state of an L4 (TCP/UDP) forwarding rule.
+// Unlike the L7 http(s) forwarding rules, which always front a target proxy on a fixed port, L4
+// forwarding rules can target a backend service directly on an arbitrary set of ports, so their
+// shape needs to be supplied by the caller rather than assumed by the syncer.
+type ForwardingRuleSpec struct {
+	// IPName is the name of a user-reserved global static IP. May be empty, in which case kubemci
+	// reserves and manages its own.
+	IPName string
+	// IPProtocol is "TCP" or "UDP".
+	IPProtocol string
+	// LoadBalancingScheme is "INTERNAL" for an internal (ILB) rule or "EXTERNAL" for a network (NetLB) one.
+	LoadBalancingScheme string
+	// Ports is an explicit list of ports to forward, e.g. ["80", "8080"]. Mutually exclusive with PortRange.
+	Ports []string
+	// PortRange is a contiguous range of ports to forward, e.g. "80-88". Mutually exclusive with Ports.
+	PortRange string
+	// Network is the self link of the network this forwarding rule belongs to.
+	Network string
+	// Subnetwork is the self link of the subnetwork this forwarding rule belongs to.
+	Subnetwork string
+	// BackendServiceLink is the self link of the backend service that this forwarding rule sends traffic to.
+	BackendServiceLink string
+}
+
 // ForwardingRuleSyncer manages GCP forwarding rules for multicluster GCP L7 load balancers.
 type ForwardingRuleSyncer struct {
 	namer *utilsnamer.Namer
 	// Instance of ForwardingRuleProvider interface for calling GCE ForwardingRule APIs.
 	// There is no separate ForwardingRuleProvider interface, so we use the bigger LoadBalancers interface here.
 	frp ingresslb.LoadBalancers
+	// as manages the controller-reserved static IP (if any) for this load balancer.
+	as address.AddressSyncerInterface
+	// logger is used for all structured, leveled logging done by this syncer.
+	logger logging.Logger
 }
 
-func NewForwardingRuleSyncer(namer *utilsnamer.Namer, frp ingresslb.LoadBalancers) ForwardingRuleSyncerInterface {
+// NewForwardingRuleSyncer returns a new syncer for managing the forwarding rules of the given load
+// balancer. A nil logger defaults to logging.NopLogger, so existing callers keep working unchanged.
+func NewForwardingRuleSyncer(namer *utilsnamer.Namer, frp ingresslb.LoadBalancers, as address.AddressSyncerInterface, logger logging.Logger) ForwardingRuleSyncerInterface {
+	if logger == nil {
+		logger = logging.NopLogger{}
+	}
 	return &ForwardingRuleSyncer{
-		namer: namer,
-		frp:   frp,
+		namer:  namer,
+		frp:    frp,
+		as:     as,
+		logger: logger,
 	}
 }
 
@@ -58,63 +93,163 @@ var _ ForwardingRuleSyncerInterface = &ForwardingRuleSyncer{}
 // EnsureHttpForwardingRule ensures that the required http forwarding rule exists.
 // Does nothing if it exists already, else creates a new one.
 // Stores the given list of clusters in the description field of forwarding rule to use it to generate status later.
-func (s *ForwardingRuleSyncer) EnsureHttpForwardingRule(lbName, ipAddress, targetProxyLink string, clusters []string, forceUpdate bool) error {
-	fmt.Println("Ensuring http forwarding rule")
-	desiredFR, err := s.desiredForwardingRule(lbName, ipAddress, targetProxyLink, clusters)
+// isResync should be true when the caller is re-syncing a load balancer whose spec has not changed from
+// the caller's point of view (e.g. a periodic resync loop), as opposed to an explicit create/update
+// triggered by a spec change. The syncer uses it only to detect accidental non-idempotency; it never
+// changes what gets synced.
+func (s *ForwardingRuleSyncer) EnsureHttpForwardingRule(lbName, ipName, targetProxyLink string, clusters []string, forceUpdate, isResync bool) (*SyncResult, error) {
+	s.logger.V(2).Info("ensuring http forwarding rule", "lb", lbName)
+	ipAddress, isIPManaged, err := s.resolveIPAddress(ipName)
 	if err != nil {
-		fmt.Println("Error getting desired forwarding rule:", err)
-		return err
+		return nil, err
+	}
+	desiredFR, err := s.desiredForwardingRule(lbName, ipAddress, targetProxyLink, clusters, false /*isHttps*/)
+	if err != nil {
+		s.logger.Error(err, "error getting desired forwarding rule", "lb", lbName)
+		return nil, err
+	}
+	return s.ensureForwardingRule(desiredFR, forceUpdate, isIPManaged, isResync)
+}
+
+// EnsureHttpsForwardingRule ensures that the required https forwarding rule exists.
+// Does nothing if it exists already, else creates a new one.
+// Stores the given list of clusters in the description field of forwarding rule to use it to generate status later.
+// See EnsureHttpForwardingRule for the meaning of isResync.
+func (s *ForwardingRuleSyncer) EnsureHttpsForwardingRule(lbName, ipName, targetProxyLink string, clusters []string, forceUpdate, isResync bool) (*SyncResult, error) {
+	s.logger.V(2).Info("ensuring https forwarding rule", "lb", lbName)
+	ipAddress, isIPManaged, err := s.resolveIPAddress(ipName)
+	if err != nil {
+		return nil, err
+	}
+	desiredFR, err := s.desiredForwardingRule(lbName, ipAddress, targetProxyLink, clusters, true /*isHttps*/)
+	if err != nil {
+		s.logger.Error(err, "error getting desired forwarding rule", "lb", lbName)
+		return nil, err
+	}
+	return s.ensureForwardingRule(desiredFR, forceUpdate, isIPManaged, isResync)
+}
+
+// EnsureL4ForwardingRule ensures that the required L4 (TCP/UDP) forwarding rule exists for the given
+// load balancer, targeting the backend service in spec.BackendServiceLink rather than a target proxy.
+// Does nothing if it exists already, else creates a new one.
+// See EnsureHttpForwardingRule for the meaning of isResync.
+func (s *ForwardingRuleSyncer) EnsureL4ForwardingRule(lbName string, spec ForwardingRuleSpec, clusters []string, forceUpdate, isResync bool) (*SyncResult, error) {
+	s.logger.V(2).Info("ensuring L4 forwarding rule", "lb", lbName, "protocol", spec.IPProtocol)
+	ipAddress, isIPManaged, err := s.resolveIPAddress(spec.IPName)
+	if err != nil {
+		return nil, err
 	}
+	desiredFR, err := s.desiredL4ForwardingRule(lbName, ipAddress, spec, clusters)
+	if err != nil {
+		s.logger.Error(err, "error getting desired forwarding rule", "lb", lbName)
+		return nil, err
+	}
+	return s.ensureForwardingRule(desiredFR, forceUpdate, isIPManaged, isResync)
+}
+
+// resolveIPAddress resolves ipName (the value of the global-static-ip-name annotation, if any) into an
+// actual IP address to use, and reports whether that IP is owned and managed by kubemci.
+func (s *ForwardingRuleSyncer) resolveIPAddress(ipName string) (ipAddress string, isIPManaged bool, err error) {
+	ipAddress, err = s.as.EnsureAddress(ipName)
+	if err != nil {
+		s.logger.Error(err, "error ensuring static IP", "ipName", ipName)
+		return "", false, err
+	}
+	return ipAddress, ipName == "", nil
+}
+
+// ensureForwardingRule ensures that the given forwarding rule exists, creating or updating it as necessary.
+func (s *ForwardingRuleSyncer) ensureForwardingRule(desiredFR *compute.ForwardingRule, forceUpdate, isIPManaged, isResync bool) (*SyncResult, error) {
 	name := desiredFR.Name
 	// Check if forwarding rule already exists.
 	existingFR, err := s.frp.GetGlobalForwardingRule(name)
 	if err == nil {
-		fmt.Println("forwarding rule", name, "exists already. Checking if it matches our desired forwarding rule", name)
-		glog.V(5).Infof("Existing forwarding rule:\n%+v\nDesired forwarding rule:\n%+v", existingFR, desiredFR)
+		s.logger.V(2).Info("forwarding rule exists already, checking if it matches desired state", "name", name)
+		s.logger.V(5).Info("comparing forwarding rules", "name", name, "existing", existingFR, "desired", desiredFR)
 		// Forwarding Rule with that name exists already. Check if it matches what we want.
 		if forwardingRuleMatches(desiredFR, existingFR) {
 			// Nothing to do. Desired forwarding rule exists already.
-			fmt.Println("Desired forwarding rule exists already")
-			return nil
+			s.logger.V(2).Info("desired forwarding rule exists already", "name", name)
+			return &SyncResult{}, nil
+		}
+		if isResync {
+			// A resync means the caller believes nothing user-visible changed, so finding a diff here
+			// points at a bug in forwardingRuleMatches/desiredForwardingRule (e.g. description reordering
+			// or default-value drift) rather than an intentional update.
+			s.logger.Error(nil, "forwarding rule differs on a resync; no spec change was expected", "name", name, "diff", reconciler.Diff(desiredFR, existingFR))
 		}
 		if forceUpdate {
-			fmt.Println("Updating existing forwarding rule", name, "to match the desired state")
-			return s.updateForwardingRule(existingFR, desiredFR)
-		} else {
-			fmt.Println("Will not overwrite this differing Forwarding Rule without the --force flag")
-			return fmt.Errorf("Will not overwrite Forwarding Rule without --force")
+			s.logger.Info("updating existing forwarding rule to match the desired state", "name", name)
+			return s.updateForwardingRule(existingFR, desiredFR, isIPManaged)
 		}
+		s.logger.Info("will not overwrite this differing forwarding rule without the --force flag", "name", name)
+		return nil, fmt.Errorf("Will not overwrite Forwarding Rule without --force")
 	}
-	glog.V(2).Infof("Got error %s while trying to get existing forwarding rule %s. Will try to create new one", err, name)
+	s.logger.V(2).Info("error fetching existing forwarding rule, will try to create a new one", "name", name, "err", err)
 	// TODO: Handle non NotFound errors. We should create only if the error is NotFound.
 	// Create the forwarding rule.
 	return s.createForwardingRule(desiredFR)
 }
 
+// DeleteForwardingRules deletes the http, https and L4 forwarding rules for this load balancer, along
+// with the controller-managed static IP (if any). Deleting a rule that does not exist is not an error.
 func (s *ForwardingRuleSyncer) DeleteForwardingRules() error {
-	// TODO(nikhiljindal): Also delete the https forwarding rule when we start creating it.
-	name := s.namer.HttpForwardingRuleName()
-	fmt.Println("Deleting forwarding rule", name)
-	err := s.frp.DeleteGlobalForwardingRule(name)
+	if err := s.DeleteHttpForwardingRule(); err != nil {
+		return err
+	}
+	if err := s.deleteForwardingRule(s.namer.HttpsForwardingRuleName()); err != nil {
+		return err
+	}
+	if err := s.deleteForwardingRule(s.namer.L4ForwardingRuleName()); err != nil {
+		return err
+	}
+	// Delete the controller-managed static IP (if any). This is a no-op if the user supplied their own.
+	return s.as.DeleteAddress()
+}
+
+// DeleteHttpForwardingRule deletes just the http forwarding rule for this load balancer, leaving the
+// https (and any L4) forwarding rule untouched. Callers use this to disable plain HTTP on an otherwise
+// unchanged load balancer, e.g. when the allow-http annotation is set to false; re-enabling it later is
+// just a call to EnsureHttpForwardingRule, which recreates the missing rule without touching the others.
+// Deleting a rule that does not exist is not an error.
+func (s *ForwardingRuleSyncer) DeleteHttpForwardingRule() error {
+	return s.deleteForwardingRule(s.namer.HttpForwardingRuleName())
+}
+
+func (s *ForwardingRuleSyncer) deleteForwardingRule(name string) error {
+	s.logger.Info("deleting forwarding rule", "name", name)
+	err := utils.IgnoreHTTPNotFound(s.frp.DeleteGlobalForwardingRule(name))
 	if err != nil {
-		fmt.Println("error", err, "in deleting forwarding rule", name)
+		s.logger.Error(err, "error deleting forwarding rule", "name", name)
 		return err
 	}
-	fmt.Println("forwarding rule", name, "deleted successfully")
+	s.logger.V(2).Info("forwarding rule deleted successfully (if it existed)", "name", name)
 	return nil
 }
 
+// GetLoadBalancerStatus returns the status of the given load balancer.
 func (s *ForwardingRuleSyncer) GetLoadBalancerStatus(lbName string) (*status.LoadBalancerStatus, error) {
-	// Fetch the http forwarding rule.
-	// TODO(nikhiljindal): Try fetching the https rule as well, once we start creating them.
-	name := s.namer.HttpForwardingRuleName()
-	fr, err := s.frp.GetGlobalForwardingRule(name)
-	if utils.IsHTTPErrorCode(err, http.StatusNotFound) {
-		// We assume the load balancer does not exist until the forwarding rule exists.
-		return nil, fmt.Errorf("Load balancer %s does not exist", lbName)
-	}
+	// Prefer the https forwarding rule when both exist, since that is the one users will be hitting.
+	fr, err := s.frp.GetGlobalForwardingRule(s.namer.HttpsForwardingRuleName())
 	if err != nil {
-		return nil, fmt.Errorf("error in fetching forwarding rule: %s. Cannot determine status without it.", err)
+		if !utils.IsHTTPErrorCode(err, http.StatusNotFound) {
+			return nil, fmt.Errorf("error in fetching https forwarding rule: %s. Cannot determine status without it.", err)
+		}
+		fr, err = s.frp.GetGlobalForwardingRule(s.namer.HttpForwardingRuleName())
+		if err != nil {
+			if !utils.IsHTTPErrorCode(err, http.StatusNotFound) {
+				return nil, fmt.Errorf("error in fetching forwarding rule: %s. Cannot determine status without it.", err)
+			}
+			// Neither http(s) forwarding rule exists; this may be a pure L4 (TCP/UDP) load balancer.
+			fr, err = s.frp.GetGlobalForwardingRule(s.namer.L4ForwardingRuleName())
+			if utils.IsHTTPErrorCode(err, http.StatusNotFound) {
+				// We assume the load balancer does not exist until one of the forwarding rules exists.
+				return nil, fmt.Errorf("Load balancer %s does not exist", lbName)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("error in fetching L4 forwarding rule: %s. Cannot determine status without it.", err)
+			}
+		}
 	}
 	status, err := status.FromString(fr.Description)
 	if err != nil {
@@ -123,64 +258,102 @@ func (s *ForwardingRuleSyncer) GetLoadBalancerStatus(lbName string) (*status.Loa
 	return status, nil
 }
 
-func (s *ForwardingRuleSyncer) updateForwardingRule(existingFR, desiredFR *compute.ForwardingRule) error {
+func (s *ForwardingRuleSyncer) updateForwardingRule(existingFR, desiredFR *compute.ForwardingRule, isIPManaged bool) (*SyncResult, error) {
 	name := desiredFR.Name
-	// We do not have an UpdateForwardingRule method.
-	// If target proxy link is the only thing that is different, then we can call SetProxyForGlobalForwardingRule.
-	// Else, we need to delete the existing rule and create a new one.
-	if existingFR.IPAddress != desiredFR.IPAddress || existingFR.PortRange != desiredFR.PortRange ||
-		existingFR.IPProtocol != desiredFR.IPProtocol || existingFR.Description != desiredFR.Description {
-		fmt.Println("Deleting the existing forwarding rule", name, "and will create a new one")
+	if existingFR.IPAddress != desiredFR.IPAddress && !isIPManaged {
+		// The user owns this IP; never let a recreate churn it out from under them.
+		s.logger.Info("preserving user-specified IP on forwarding rule", "name", name, "ip", existingFR.IPAddress)
+		desiredFR.IPAddress = existingFR.IPAddress
+	}
+	diffs := reconciler.Diff(desiredFR, existingFR)
+	result := syncResultFromDiffs(diffs)
+	switch reconciler.Classify(diffs) {
+	case reconciler.RequiresRecreate:
+		// We do not have an UpdateForwardingRule method, and GCE does not allow mutating these fields on
+		// an existing forwarding rule in place, so we delete the existing rule and create a new one.
+		s.logger.Info("deleting the existing forwarding rule and will create a new one", "name", name, "diff", diffs)
 		if err := utils.IgnoreHTTPNotFound(s.frp.DeleteGlobalForwardingRule(name)); err != nil {
-			fmt.Println("Error deleting global forwarding rule:", err)
-			return fmt.Errorf("error in deleting existing forwarding rule %s: %s", name, err)
+			s.logger.Error(err, "error deleting global forwarding rule", "name", name)
+			return nil, fmt.Errorf("error in deleting existing forwarding rule %s: %s", name, err)
+		}
+		if _, err := s.createForwardingRule(desiredFR); err != nil {
+			return nil, err
+		}
+		result.Recreated = true
+		return result, nil
+	case reconciler.Mutable:
+		// Only mutable fields (e.g. Target) differ, so we can update them in place.
+		err := s.frp.SetProxyForGlobalForwardingRule(name, desiredFR.Target)
+		if err != nil {
+			s.logger.Error(err, "error setting proxy for forwarding rule", "name", name, "target", desiredFR.Target)
+			return nil, err
 		}
-		return s.createForwardingRule(desiredFR)
+		s.logger.Info("forwarding rule updated successfully", "name", name)
+		return result, nil
+	default:
+		// No diffs; nothing to do. forwardingRuleMatches should already have caught this, but be defensive.
+		return result, nil
 	}
-	// Update target proxy link in forwarding rule.
-	err := s.frp.SetProxyForGlobalForwardingRule(name, desiredFR.Target)
-	if err != nil {
-		fmt.Println("Error setting proxy for forwarding rule. Target:", desiredFR.Target, "Error:", err)
-		return err
+}
+
+// syncResultFromDiffs translates the field-level diffs produced by the reconciler package into the
+// named booleans that SyncResult exposes to callers.
+func syncResultFromDiffs(diffs []reconciler.FieldDiff) *SyncResult {
+	result := &SyncResult{}
+	for _, d := range diffs {
+		switch d.Field {
+		case "IPAddress":
+			result.IPChanged = true
+		case "PortRange", "Ports":
+			result.PortsChanged = true
+		case "IPProtocol":
+			result.ProtocolChanged = true
+		case "LoadBalancingScheme":
+			result.SchemeChanged = true
+		case "Subnetwork":
+			result.SubnetworkChanged = true
+		case "Description":
+			result.DescriptionChanged = true
+		case "Target", "BackendService":
+			result.TargetChanged = true
+		}
 	}
-	fmt.Println("Forwarding rule", name, "updated successfully")
-	return nil
+	return result
 }
 
-func (s *ForwardingRuleSyncer) createForwardingRule(desiredFR *compute.ForwardingRule) error {
+func (s *ForwardingRuleSyncer) createForwardingRule(desiredFR *compute.ForwardingRule) (*SyncResult, error) {
 	name := desiredFR.Name
-	fmt.Println("Creating forwarding rule", name)
-	glog.V(5).Infof("Creating forwarding rule %v", desiredFR)
+	s.logger.Info("creating forwarding rule", "name", name)
+	s.logger.V(5).Info("creating forwarding rule", "name", name, "rule", desiredFR)
 	err := s.frp.CreateGlobalForwardingRule(desiredFR)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	fmt.Println("Forwarding rule", name, "created successfully")
-	return nil
+	s.logger.Info("forwarding rule created successfully", "name", name)
+	return &SyncResult{Created: true}, nil
 }
 
+// forwardingRuleMatches returns true if existingFR already matches desiredFR on every field we own
+// (see reconciler.ForwardingRuleFields); server-owned fields such as CreationTimestamp, Id, Kind and
+// SelfLink are ignored.
 func forwardingRuleMatches(desiredFR, existingFR *compute.ForwardingRule) bool {
-	existingFR.CreationTimestamp = ""
-	existingFR.Id = 0
-	existingFR.Kind = ""
-	existingFR.SelfLink = ""
-	existingFR.ServerResponse = googleapi.ServerResponse{}
-
-	equal := reflect.DeepEqual(existingFR, desiredFR)
-	if !equal {
-		glog.V(5).Infof("Forwarding Rules differ:\n%v", diff.ObjectDiff(desiredFR, existingFR))
-	} else {
-		glog.V(2).Infof("Rules match.")
-	}
-
-	return equal
+	diffs := reconciler.Diff(desiredFR, existingFR)
+	return len(diffs) == 0
 }
 
-func (s *ForwardingRuleSyncer) desiredForwardingRule(lbName, ipAddress, targetProxyLink string, clusters []string) (*compute.ForwardingRule, error) {
+func (s *ForwardingRuleSyncer) desiredForwardingRule(lbName, ipAddress, targetProxyLink string, clusters []string, isHttps bool) (*compute.ForwardingRule, error) {
 	// Sort the clusters so we get a deterministic order.
 	sort.Strings(clusters)
+	protocol := "http"
+	name := s.namer.HttpForwardingRuleName()
+	portRange := httpDefaultPortRange
+	if isHttps {
+		protocol = "https"
+		name = s.namer.HttpsForwardingRuleName()
+		portRange = httpsDefaultPortRange
+	}
 	status := status.LoadBalancerStatus{
-		Description:      fmt.Sprintf("Http forwarding rule for kubernetes multicluster loadbalancer %s", lbName),
+		Description:      fmt.Sprintf("%s forwarding rule for kubernetes multicluster loadbalancer %s", strings.Title(protocol), lbName),
 		LoadBalancerName: lbName,
 		Clusters:         clusters,
 		IPAddress:        ipAddress,
@@ -191,12 +364,39 @@ func (s *ForwardingRuleSyncer) desiredForwardingRule(lbName, ipAddress, targetPr
 	}
 	// Compute the desired forwarding rule.
 	return &compute.ForwardingRule{
-		Name:                s.namer.HttpForwardingRuleName(),
+		Name:                name,
 		Description:         desc,
 		IPAddress:           ipAddress,
 		Target:              targetProxyLink,
-		PortRange:           httpDefaultPortRange,
+		PortRange:           portRange,
 		IPProtocol:          "TCP",
 		LoadBalancingScheme: "EXTERNAL",
 	}, nil
 }
+
+func (s *ForwardingRuleSyncer) desiredL4ForwardingRule(lbName, ipAddress string, spec ForwardingRuleSpec, clusters []string) (*compute.ForwardingRule, error) {
+	// Sort the clusters so we get a deterministic order.
+	sort.Strings(clusters)
+	status := status.LoadBalancerStatus{
+		Description:      fmt.Sprintf("%s forwarding rule for kubernetes multicluster loadbalancer %s", spec.IPProtocol, lbName),
+		LoadBalancerName: lbName,
+		Clusters:         clusters,
+		IPAddress:        ipAddress,
+	}
+	desc, err := status.ToString()
+	if err != nil {
+		return nil, fmt.Errorf("unexpected error in generating the description for forwarding rule: %s", err)
+	}
+	return &compute.ForwardingRule{
+		Name:                s.namer.L4ForwardingRuleName(),
+		Description:         desc,
+		IPAddress:           ipAddress,
+		BackendService:      spec.BackendServiceLink,
+		Ports:               spec.Ports,
+		PortRange:           spec.PortRange,
+		IPProtocol:          spec.IPProtocol,
+		LoadBalancingScheme: spec.LoadBalancingScheme,
+		Network:             spec.Network,
+		Subnetwork:          spec.Subnetwork,
+	}, nil
+}
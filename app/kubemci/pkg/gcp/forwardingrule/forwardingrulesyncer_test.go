@@ -0,0 +1,289 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package forwardingrule
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"google.golang.org/api/googleapi"
+
+	compute "google.golang.org/api/compute/v1"
+
+	ingresslb "k8s.io/ingress-gce/pkg/loadbalancers"
+
+	"github.com/GoogleCloudPlatform/k8s-multicluster-ingress/app/kubemci/pkg/gcp/logging"
+	utilsnamer "github.com/GoogleCloudPlatform/k8s-multicluster-ingress/app/kubemci/pkg/gcp/namer"
+	"github.com/GoogleCloudPlatform/k8s-multicluster-ingress/app/kubemci/pkg/gcp/status"
+)
+
+// fakeLoadBalancers fakes out just the forwarding-rule methods of ingresslb.LoadBalancers that the
+// syncer calls. It embeds the real interface (left nil) so it satisfies ingresslb.LoadBalancers without
+// having to stub every unrelated L7 method (url maps, target proxies, ssl certs, ...); calling any of
+// those would panic, but these tests never exercise them.
+type fakeLoadBalancers struct {
+	ingresslb.LoadBalancers
+	rules         map[string]*compute.ForwardingRule
+	deleteCalls   []string
+	createCalls   []string
+	setProxyCalls []string
+}
+
+func newFakeLoadBalancers() *fakeLoadBalancers {
+	return &fakeLoadBalancers{rules: map[string]*compute.ForwardingRule{}}
+}
+
+func (f *fakeLoadBalancers) GetGlobalForwardingRule(name string) (*compute.ForwardingRule, error) {
+	if fr, ok := f.rules[name]; ok {
+		return fr, nil
+	}
+	return nil, &googleapi.Error{Code: http.StatusNotFound, Message: fmt.Sprintf("forwarding rule %s not found", name)}
+}
+
+func (f *fakeLoadBalancers) CreateGlobalForwardingRule(fr *compute.ForwardingRule) error {
+	f.createCalls = append(f.createCalls, fr.Name)
+	f.rules[fr.Name] = fr
+	return nil
+}
+
+func (f *fakeLoadBalancers) DeleteGlobalForwardingRule(name string) error {
+	f.deleteCalls = append(f.deleteCalls, name)
+	delete(f.rules, name)
+	return nil
+}
+
+func (f *fakeLoadBalancers) SetProxyForGlobalForwardingRule(name, targetLink string) error {
+	f.setProxyCalls = append(f.setProxyCalls, name)
+	f.rules[name].Target = targetLink
+	return nil
+}
+
+// recordingLogger records every Error call made against it, so tests can assert that a particular log
+// path was (or was not) taken.
+type recordingLogger struct {
+	errors []string
+}
+
+func (l *recordingLogger) Info(msg string, keysAndValues ...interface{}) {}
+
+func (l *recordingLogger) Error(err error, msg string, keysAndValues ...interface{}) {
+	l.errors = append(l.errors, msg)
+}
+
+func (l *recordingLogger) V(level int) logging.Logger { return l }
+
+func baseForwardingRule() *compute.ForwardingRule {
+	return &compute.ForwardingRule{
+		Name:                "fr1",
+		Description:         "desc",
+		IPAddress:           "1.2.3.4",
+		Target:              "target1",
+		PortRange:           "80-80",
+		IPProtocol:          "TCP",
+		LoadBalancingScheme: "EXTERNAL",
+	}
+}
+
+func TestUpdateForwardingRuleMutable(t *testing.T) {
+	frp := newFakeLoadBalancers()
+	existing := baseForwardingRule()
+	frp.rules[existing.Name] = existing
+	s := &ForwardingRuleSyncer{frp: frp, logger: logging.NopLogger{}}
+
+	desired := baseForwardingRule()
+	desired.Target = "target2"
+
+	result, err := s.updateForwardingRule(existing, desired, true /*isIPManaged*/)
+	if err != nil {
+		t.Fatalf("updateForwardingRule() returned error: %v", err)
+	}
+	if len(frp.setProxyCalls) != 1 {
+		t.Errorf("SetProxyForGlobalForwardingRule called %d times, want 1", len(frp.setProxyCalls))
+	}
+	if len(frp.deleteCalls) != 0 || len(frp.createCalls) != 0 {
+		t.Errorf("a Target-only change should not delete or recreate the rule, got deletes=%v creates=%v", frp.deleteCalls, frp.createCalls)
+	}
+	if !result.TargetChanged || result.Recreated {
+		t.Errorf("result = %+v, want TargetChanged=true, Recreated=false", result)
+	}
+}
+
+func TestUpdateForwardingRuleRequiresRecreate(t *testing.T) {
+	frp := newFakeLoadBalancers()
+	existing := baseForwardingRule()
+	frp.rules[existing.Name] = existing
+	s := &ForwardingRuleSyncer{frp: frp, logger: logging.NopLogger{}}
+
+	desired := baseForwardingRule()
+	desired.IPAddress = "5.6.7.8"
+
+	result, err := s.updateForwardingRule(existing, desired, true /*isIPManaged*/)
+	if err != nil {
+		t.Fatalf("updateForwardingRule() returned error: %v", err)
+	}
+	if len(frp.deleteCalls) != 1 || len(frp.createCalls) != 1 {
+		t.Errorf("an IP change should delete and recreate the rule, got deletes=%v creates=%v", frp.deleteCalls, frp.createCalls)
+	}
+	if len(frp.setProxyCalls) != 0 {
+		t.Errorf("SetProxyForGlobalForwardingRule should not be called on a recreate, called %d times", len(frp.setProxyCalls))
+	}
+	if !result.Recreated || !result.IPChanged {
+		t.Errorf("result = %+v, want Recreated=true, IPChanged=true", result)
+	}
+}
+
+func TestUpdateForwardingRulePreservesUnmanagedIP(t *testing.T) {
+	frp := newFakeLoadBalancers()
+	existing := baseForwardingRule()
+	existing.IPAddress = "9.9.9.9"
+	frp.rules[existing.Name] = existing
+	s := &ForwardingRuleSyncer{frp: frp, logger: logging.NopLogger{}}
+
+	desired := baseForwardingRule()
+	desired.IPAddress = "5.6.7.8"
+
+	result, err := s.updateForwardingRule(existing, desired, false /*isIPManaged*/)
+	if err != nil {
+		t.Fatalf("updateForwardingRule() returned error: %v", err)
+	}
+	if desired.IPAddress != "9.9.9.9" {
+		t.Errorf("desired.IPAddress = %s, want the user-specified IP 9.9.9.9 to be preserved", desired.IPAddress)
+	}
+	if result.IPChanged {
+		t.Errorf("result = %+v, want IPChanged=false once the user IP is preserved", result)
+	}
+}
+
+func TestEnsureForwardingRuleLogsOnUnexpectedResyncDiff(t *testing.T) {
+	frp := newFakeLoadBalancers()
+	existing := baseForwardingRule()
+	frp.rules[existing.Name] = existing
+	logger := &recordingLogger{}
+	s := &ForwardingRuleSyncer{frp: frp, logger: logger}
+
+	desired := baseForwardingRule()
+	desired.Description = "a different description"
+
+	if _, err := s.ensureForwardingRule(desired, false /*forceUpdate*/, true /*isIPManaged*/, true /*isResync*/); err == nil {
+		t.Fatalf("ensureForwardingRule() with forceUpdate=false should return an error when the rule differs")
+	}
+	if len(logger.errors) != 1 {
+		t.Errorf("logger.Error called %d times, want exactly 1 for the unexpected resync diff", len(logger.errors))
+	}
+}
+
+func TestEnsureForwardingRuleNoLogWhenNotResync(t *testing.T) {
+	frp := newFakeLoadBalancers()
+	existing := baseForwardingRule()
+	frp.rules[existing.Name] = existing
+	logger := &recordingLogger{}
+	s := &ForwardingRuleSyncer{frp: frp, logger: logger}
+
+	desired := baseForwardingRule()
+	desired.Description = "a different description"
+
+	if _, err := s.ensureForwardingRule(desired, false /*forceUpdate*/, true /*isIPManaged*/, false /*isResync*/); err == nil {
+		t.Fatalf("ensureForwardingRule() with forceUpdate=false should return an error when the rule differs")
+	}
+	if len(logger.errors) != 0 {
+		t.Errorf("logger.Error called %d times, want 0 outside of a resync", len(logger.errors))
+	}
+}
+
+func statusDescription(t *testing.T, lbName, description string) string {
+	t.Helper()
+	desc, err := status.LoadBalancerStatus{Description: description, LoadBalancerName: lbName}.ToString()
+	if err != nil {
+		t.Fatalf("error building status description: %v", err)
+	}
+	return desc
+}
+
+func TestGetLoadBalancerStatus(t *testing.T) {
+	lbName := "lb1"
+	namer := utilsnamer.NewNamer(lbName)
+
+	testCases := []struct {
+		desc      string
+		httpsRule bool
+		httpRule  bool
+		l4Rule    bool
+		wantDesc  string
+		wantErr   bool
+	}{
+		{
+			desc:      "https rule exists, preferred over http",
+			httpsRule: true,
+			httpRule:  true,
+			wantDesc:  "https",
+		},
+		{
+			desc:     "only http rule exists, falls back to it",
+			httpRule: true,
+			wantDesc: "http",
+		},
+		{
+			desc:     "only L4 rule exists, falls back to it",
+			l4Rule:   true,
+			wantDesc: "l4",
+		},
+		{
+			desc:    "none of the rules exist",
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			frp := newFakeLoadBalancers()
+			if tc.httpsRule {
+				frp.rules[namer.HttpsForwardingRuleName()] = &compute.ForwardingRule{
+					Name:        namer.HttpsForwardingRuleName(),
+					Description: statusDescription(t, lbName, "https"),
+				}
+			}
+			if tc.httpRule {
+				frp.rules[namer.HttpForwardingRuleName()] = &compute.ForwardingRule{
+					Name:        namer.HttpForwardingRuleName(),
+					Description: statusDescription(t, lbName, "http"),
+				}
+			}
+			if tc.l4Rule {
+				frp.rules[namer.L4ForwardingRuleName()] = &compute.ForwardingRule{
+					Name:        namer.L4ForwardingRuleName(),
+					Description: statusDescription(t, lbName, "l4"),
+				}
+			}
+			s := &ForwardingRuleSyncer{namer: namer, frp: frp, logger: logging.NopLogger{}}
+
+			got, err := s.GetLoadBalancerStatus(lbName)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("GetLoadBalancerStatus() = %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetLoadBalancerStatus() returned error: %v", err)
+			}
+			if got.LoadBalancerName != lbName {
+				t.Errorf("GetLoadBalancerStatus().LoadBalancerName = %s, want %s", got.LoadBalancerName, lbName)
+			}
+			if got.Description != tc.wantDesc {
+				t.Errorf("GetLoadBalancerStatus().Description = %s, want %s (status read from the wrong rule)", got.Description, tc.wantDesc)
+			}
+		})
+	}
+}
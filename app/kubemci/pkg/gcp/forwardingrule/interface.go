@@ -0,0 +1,55 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package forwardingrule
+
+import (
+	"github.com/GoogleCloudPlatform/k8s-multicluster-ingress/app/kubemci/pkg/gcp/status"
+)
+
+// ForwardingRuleSyncerInterface manages GCP forwarding rules for multicluster GCP L7 (http/https) and
+// L4 (TCP/UDP) load balancers.
+type ForwardingRuleSyncerInterface interface {
+	// EnsureHttpForwardingRule ensures that the required http forwarding rule exists for the given load balancer.
+	// ipName is the name of a user-reserved global static IP (may be empty, in which case kubemci reserves
+	// and manages its own). Does nothing if the forwarding rule exists already, else creates a new one.
+	// isResync should be true when this call is a periodic resync rather than a reaction to a spec change;
+	// the syncer uses it only to detect and log accidental non-idempotency, never to change behavior.
+	// Returns a SyncResult describing what, if anything, was changed.
+	EnsureHttpForwardingRule(lbName, ipName, targetProxyLink string, clusters []string, forceUpdate, isResync bool) (*SyncResult, error)
+
+	// EnsureHttpsForwardingRule ensures that the required https forwarding rule exists for the given load balancer.
+	// ipName is the name of a user-reserved global static IP (may be empty, in which case kubemci reserves
+	// and manages its own). Does nothing if the forwarding rule exists already, else creates a new one.
+	// See EnsureHttpForwardingRule for the meaning of isResync.
+	EnsureHttpsForwardingRule(lbName, ipName, targetProxyLink string, clusters []string, forceUpdate, isResync bool) (*SyncResult, error)
+
+	// EnsureL4ForwardingRule ensures that the required L4 (TCP/UDP) forwarding rule exists for the given
+	// load balancer, targeting spec.BackendServiceLink rather than a target proxy. Does nothing if it
+	// exists already, else creates a new one. See EnsureHttpForwardingRule for the meaning of isResync.
+	EnsureL4ForwardingRule(lbName string, spec ForwardingRuleSpec, clusters []string, forceUpdate, isResync bool) (*SyncResult, error)
+
+	// DeleteForwardingRules deletes the forwarding rules that Ensure*ForwardingRule created, along with the
+	// controller-managed static IP (if any).
+	DeleteForwardingRules() error
+
+	// DeleteHttpForwardingRule deletes just the http forwarding rule for this load balancer, leaving
+	// any https (or L4) forwarding rule untouched. Used to disable plain HTTP (e.g. allow-http=false)
+	// without tearing down the rest of the load balancer; re-enabling it is a call to
+	// EnsureHttpForwardingRule.
+	DeleteHttpForwardingRule() error
+
+	// GetLoadBalancerStatus returns the status of the given load balancer.
+	GetLoadBalancerStatus(lbName string) (*status.LoadBalancerStatus, error)
+}
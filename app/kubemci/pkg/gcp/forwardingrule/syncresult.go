@@ -0,0 +1,79 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package forwardingrule
+
+// SyncResult describes what changed, if anything, as a result of an Ensure*ForwardingRule call.
+// Callers use it to log a human-readable account of what kubemci did and to export per-field
+// update counts as metrics, instead of having to re-derive that information from a bare error.
+type SyncResult struct {
+	// Created is true if a forwarding rule did not exist and was created.
+	Created bool
+	// Recreated is true if an existing forwarding rule had to be deleted and recreated because one of
+	// its immutable fields (IP, ports, protocol, network, subnetwork, load balancing scheme, description
+	// or backend service) changed.
+	Recreated bool
+	// TargetChanged is true if the target proxy / backend service link was updated.
+	TargetChanged bool
+	// DescriptionChanged is true if the description (and hence the stored cluster list/IP) changed.
+	DescriptionChanged bool
+	// IPChanged is true if the IP address changed.
+	IPChanged bool
+	// PortsChanged is true if the port range or port list changed.
+	PortsChanged bool
+	// ProtocolChanged is true if the IP protocol changed.
+	ProtocolChanged bool
+	// SchemeChanged is true if the load balancing scheme changed.
+	SchemeChanged bool
+	// SubnetworkChanged is true if the subnetwork changed.
+	SubnetworkChanged bool
+}
+
+// Changed returns true if this result represents any modification to the forwarding rule.
+func (r *SyncResult) Changed() bool {
+	if r == nil {
+		return false
+	}
+	return r.Created || r.Recreated || r.TargetChanged || r.DescriptionChanged ||
+		r.IPChanged || r.PortsChanged || r.ProtocolChanged || r.SchemeChanged || r.SubnetworkChanged
+}
+
+// ResourceUpdates aggregates the SyncResults of the forwarding rules owned by a single load balancer
+// sync, so that upper-layer sync loops can log or export them as metrics in one place.
+type ResourceUpdates struct {
+	// Results maps forwarding rule name to the result of syncing it.
+	Results map[string]*SyncResult
+}
+
+// NewResourceUpdates returns an empty ResourceUpdates.
+func NewResourceUpdates() *ResourceUpdates {
+	return &ResourceUpdates{
+		Results: map[string]*SyncResult{},
+	}
+}
+
+// Add records the sync result for the forwarding rule with the given name.
+func (u *ResourceUpdates) Add(name string, result *SyncResult) {
+	u.Results[name] = result
+}
+
+// Changed returns true if any of the aggregated results represent a modification.
+func (u *ResourceUpdates) Changed() bool {
+	for _, result := range u.Results {
+		if result.Changed() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package logging defines the structured logging interface used across the kubemci gcp syncers.
+package logging
+
+// Logger is a minimal logr.Logger-style structured logging interface. It mirrors the Info/Error/V
+// shape of github.com/go-logr/logr.Logger, so callers embedding kubemci in a larger controller can
+// route its logs into their own logr-based logger instead of unparseable stdout prints. Because V
+// returns this package's Logger, a logr.Logger does not satisfy this interface as is; it has to be
+// wrapped in a small adapter.
+type Logger interface {
+	// Info logs a non-error message along with the given structured key/value pairs.
+	Info(msg string, keysAndValues ...interface{})
+	// Error logs an error along with the given structured key/value pairs.
+	Error(err error, msg string, keysAndValues ...interface{})
+	// V returns a Logger for the given verbosity level; higher levels are more verbose and are
+	// typically suppressed unless the caller has turned up logging.
+	V(level int) Logger
+}
+
+// NopLogger is a Logger that discards everything. It is the default used by the syncers when no
+// logger is supplied, so that existing callers keep working unchanged.
+type NopLogger struct{}
+
+// Info is a no-op.
+func (NopLogger) Info(msg string, keysAndValues ...interface{}) {}
+
+// Error is a no-op.
+func (NopLogger) Error(err error, msg string, keysAndValues ...interface{}) {}
+
+// V returns the same nop logger at every verbosity level.
+func (n NopLogger) V(level int) Logger {
+	return n
+}
+
+// Ensure NopLogger implements Logger.
+var _ Logger = NopLogger{}
@@ -0,0 +1,71 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package namer
+
+import (
+	"fmt"
+)
+
+const (
+	// namePrefix is prepended to all resource names created by kubemci, so that we can easily identify them.
+	namePrefix = "mci1"
+
+	httpForwardingRuleSuffix  = "fw"
+	httpsForwardingRuleSuffix = "fws"
+	ipAddressSuffix           = "ip"
+	l4ForwardingRuleSuffix    = "fw-l4"
+)
+
+// Namer generates names for the GCP resources that kubemci creates for a multicluster ingress.
+type Namer struct {
+	lbName string
+}
+
+// NewNamer returns a new namer for the given load balancer name.
+func NewNamer(lbName string) *Namer {
+	return &Namer{
+		lbName: lbName,
+	}
+}
+
+// prefix returns the common prefix used for all resources of this load balancer.
+func (n *Namer) prefix() string {
+	return fmt.Sprintf("%s-%s", namePrefix, n.lbName)
+}
+
+// HttpForwardingRuleName returns the name to use for the http forwarding rule for this load balancer.
+func (n *Namer) HttpForwardingRuleName() string {
+	return fmt.Sprintf("%s-%s", n.prefix(), httpForwardingRuleSuffix)
+}
+
+// HttpsForwardingRuleName returns the name to use for the https forwarding rule for this load balancer.
+func (n *Namer) HttpsForwardingRuleName() string {
+	return fmt.Sprintf("%s-%s", n.prefix(), httpsForwardingRuleSuffix)
+}
+
+// IPAddressName returns the name to use for the controller-managed global static IP for this load balancer.
+func (n *Namer) IPAddressName() string {
+	return fmt.Sprintf("%s-%s", n.prefix(), ipAddressSuffix)
+}
+
+// L4ForwardingRuleName returns the name to use for the L4 (TCP/UDP) forwarding rule for this load balancer.
+func (n *Namer) L4ForwardingRuleName() string {
+	return fmt.Sprintf("%s-%s", n.prefix(), l4ForwardingRuleSuffix)
+}
+
+// LbName returns the load balancer name that this namer was created for.
+func (n *Namer) LbName() string {
+	return n.lbName
+}
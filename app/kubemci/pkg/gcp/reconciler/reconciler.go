@@ -0,0 +1,120 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package reconciler computes and classifies field-level differences between the forwarding rule
+// kubemci wants (desired) and the one GCE currently has (existing), so that callers do not need to
+// hand-roll reflect.DeepEqual comparisons or inline "which fields force a recreate" logic.
+package reconciler
+
+import (
+	"fmt"
+	"reflect"
+
+	compute "google.golang.org/api/compute/v1"
+)
+
+// FieldClass classifies how a difference in a particular field should be handled.
+type FieldClass int
+
+const (
+	// Ignored fields are server-populated (CreationTimestamp, Id, Kind, SelfLink, ...) and never
+	// participate in diffing.
+	Ignored FieldClass = iota
+	// Mutable fields can be updated on an existing forwarding rule in place, e.g. via SetTarget.
+	Mutable
+	// RequiresRecreate fields cannot be mutated on an existing forwarding rule; a difference here means
+	// the rule must be deleted and recreated.
+	RequiresRecreate
+)
+
+func (c FieldClass) String() string {
+	switch c {
+	case Mutable:
+		return "Mutable"
+	case RequiresRecreate:
+		return "RequiresRecreate"
+	default:
+		return "Ignored"
+	}
+}
+
+// ForwardingRuleFields is the canonical classification of the user-owned fields of a
+// compute.ForwardingRule. Fields not listed here (CreationTimestamp, Id, Kind, SelfLink,
+// ServerResponse, ...) are server-owned and are always Ignored.
+//
+// Adding support for a new field (e.g. AllPorts, NetworkTier, ServiceLabel) only requires adding an
+// entry here; Diff and the syncer's update logic pick it up automatically.
+var ForwardingRuleFields = map[string]FieldClass{
+	"IPAddress":           RequiresRecreate,
+	"PortRange":           RequiresRecreate,
+	"Ports":               RequiresRecreate,
+	"IPProtocol":          RequiresRecreate,
+	"Subnetwork":          RequiresRecreate,
+	"LoadBalancingScheme": RequiresRecreate,
+	"Network":             RequiresRecreate,
+	"Description":         RequiresRecreate,
+	// BackendService is only set on L4 forwarding rules, and like the other fields above GCE does not
+	// allow mutating it in place; a change requires delete+recreate, unlike Target below.
+	"BackendService": RequiresRecreate,
+	"Target":         Mutable,
+}
+
+// FieldDiff describes a single field that differs between the desired and existing forwarding rule.
+type FieldDiff struct {
+	Field    string
+	Class    FieldClass
+	Desired  interface{}
+	Existing interface{}
+}
+
+// String returns a human-readable description of the diff, suitable for logging.
+func (d FieldDiff) String() string {
+	return fmt.Sprintf("%s (%s): desired=%v, existing=%v", d.Field, d.Class, d.Desired, d.Existing)
+}
+
+// Diff compares the fields of desired and existing that are listed in ForwardingRuleFields and
+// returns one FieldDiff per field that differs.
+func Diff(desired, existing *compute.ForwardingRule) []FieldDiff {
+	var diffs []FieldDiff
+	desiredVal := reflect.ValueOf(desired).Elem()
+	existingVal := reflect.ValueOf(existing).Elem()
+	for field, class := range ForwardingRuleFields {
+		d := desiredVal.FieldByName(field).Interface()
+		e := existingVal.FieldByName(field).Interface()
+		if !reflect.DeepEqual(d, e) {
+			diffs = append(diffs, FieldDiff{
+				Field:    field,
+				Class:    class,
+				Desired:  d,
+				Existing: e,
+			})
+		}
+	}
+	return diffs
+}
+
+// Classify returns the overall classification of a set of diffs: RequiresRecreate if any diff requires
+// it, else Mutable if there is at least one mutable diff, else Ignored if there are no diffs at all.
+func Classify(diffs []FieldDiff) FieldClass {
+	class := Ignored
+	for _, d := range diffs {
+		if d.Class == RequiresRecreate {
+			return RequiresRecreate
+		}
+		if d.Class == Mutable {
+			class = Mutable
+		}
+	}
+	return class
+}
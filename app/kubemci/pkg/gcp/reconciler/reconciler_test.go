@@ -0,0 +1,118 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reconciler
+
+import (
+	"testing"
+
+	compute "google.golang.org/api/compute/v1"
+)
+
+func TestDiffNoDifference(t *testing.T) {
+	fr := &compute.ForwardingRule{
+		Name:       "fr1",
+		IPAddress:  "1.2.3.4",
+		Target:     "target1",
+		PortRange:  "80-80",
+		IPProtocol: "TCP",
+	}
+	diffs := Diff(fr, fr)
+	if len(diffs) != 0 {
+		t.Errorf("Diff(fr, fr) = %v, want no diffs for an unchanged rule", diffs)
+	}
+	if got := Classify(diffs); got != Ignored {
+		t.Errorf("Classify(no diffs) = %v, want Ignored", got)
+	}
+}
+
+func TestDiffIgnoresServerOwnedFields(t *testing.T) {
+	desired := &compute.ForwardingRule{Name: "fr1", IPAddress: "1.2.3.4"}
+	existing := &compute.ForwardingRule{
+		Name:              "fr1",
+		IPAddress:         "1.2.3.4",
+		Id:                42,
+		CreationTimestamp: "2017-01-01T00:00:00Z",
+		SelfLink:          "https://compute.googleapis.com/.../fr1",
+	}
+	diffs := Diff(desired, existing)
+	if len(diffs) != 0 {
+		t.Errorf("Diff() = %v, want server-owned fields (Id, CreationTimestamp, SelfLink) to be ignored", diffs)
+	}
+}
+
+func TestDiffPerField(t *testing.T) {
+	base := func() *compute.ForwardingRule {
+		return &compute.ForwardingRule{
+			Name:                "fr1",
+			Description:         "desc",
+			IPAddress:           "1.2.3.4",
+			Target:              "target1",
+			PortRange:           "80-80",
+			IPProtocol:          "TCP",
+			LoadBalancingScheme: "EXTERNAL",
+			Network:             "network1",
+			Subnetwork:          "subnetwork1",
+			BackendService:      "backend1",
+		}
+	}
+
+	testCases := []struct {
+		field  string
+		class  FieldClass
+		mutate func(fr *compute.ForwardingRule)
+	}{
+		{"IPAddress", RequiresRecreate, func(fr *compute.ForwardingRule) { fr.IPAddress = "5.6.7.8" }},
+		{"PortRange", RequiresRecreate, func(fr *compute.ForwardingRule) { fr.PortRange = "443-443" }},
+		{"Ports", RequiresRecreate, func(fr *compute.ForwardingRule) { fr.Ports = []string{"80"} }},
+		{"IPProtocol", RequiresRecreate, func(fr *compute.ForwardingRule) { fr.IPProtocol = "UDP" }},
+		{"Subnetwork", RequiresRecreate, func(fr *compute.ForwardingRule) { fr.Subnetwork = "subnetwork2" }},
+		{"LoadBalancingScheme", RequiresRecreate, func(fr *compute.ForwardingRule) { fr.LoadBalancingScheme = "INTERNAL" }},
+		{"Network", RequiresRecreate, func(fr *compute.ForwardingRule) { fr.Network = "network2" }},
+		{"Description", RequiresRecreate, func(fr *compute.ForwardingRule) { fr.Description = "other desc" }},
+		{"BackendService", RequiresRecreate, func(fr *compute.ForwardingRule) { fr.BackendService = "backend2" }},
+		{"Target", Mutable, func(fr *compute.ForwardingRule) { fr.Target = "target2" }},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.field, func(t *testing.T) {
+			desired := base()
+			existing := base()
+			tc.mutate(existing)
+			diffs := Diff(desired, existing)
+			if len(diffs) != 1 {
+				t.Fatalf("Diff() = %v, want exactly one diff for field %s", diffs, tc.field)
+			}
+			if diffs[0].Field != tc.field {
+				t.Errorf("diffs[0].Field = %s, want %s", diffs[0].Field, tc.field)
+			}
+			if diffs[0].Class != tc.class {
+				t.Errorf("diffs[0].Class = %v, want %v", diffs[0].Class, tc.class)
+			}
+			if got := Classify(diffs); got != tc.class {
+				t.Errorf("Classify(%v) = %v, want %v", diffs, got, tc.class)
+			}
+		})
+	}
+}
+
+func TestClassifyRequiresRecreateWinsOverMutable(t *testing.T) {
+	diffs := []FieldDiff{
+		{Field: "Target", Class: Mutable},
+		{Field: "IPAddress", Class: RequiresRecreate},
+	}
+	if got := Classify(diffs); got != RequiresRecreate {
+		t.Errorf("Classify(%v) = %v, want RequiresRecreate", diffs, got)
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright 2017 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package status defines the status that kubemci stores in the description field of the
+// GCP resources it creates, so that it can later recover that state without any other
+// external storage.
+package status
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// LoadBalancerStatus stores information about a multicluster load balancer.
+// It is serialized into the description field of the forwarding rule for the load balancer
+// so that kubemci can determine the status of a load balancer without needing any other storage.
+type LoadBalancerStatus struct {
+	Description      string
+	LoadBalancerName string
+	Clusters         []string
+	IPAddress        string
+}
+
+// ToString returns the given status serialized as a json string.
+func (l LoadBalancerStatus) ToString() (string, error) {
+	bytes, err := json.Marshal(l)
+	if err != nil {
+		return "", fmt.Errorf("error in marshalling status: %s", err)
+	}
+	return string(bytes), nil
+}
+
+// FromString parses the given json string into a LoadBalancerStatus struct.
+func FromString(str string) (*LoadBalancerStatus, error) {
+	var status LoadBalancerStatus
+	if err := json.Unmarshal([]byte(str), &status); err != nil {
+		return nil, fmt.Errorf("error in unmarshalling %s: %s", str, err)
+	}
+	return &status, nil
+}